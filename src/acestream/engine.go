@@ -78,11 +78,26 @@ type versionResp struct {
 
 // searchResp represents response to search request to engine.
 type searchResp struct {
-	Result struct {
-		Total   int            `json:"total"`
-		Results []SearchResult `json:"results"`
-		Time    float64        `json:"time"`
-	} `json:"result"`
+	Result searchRespResult `json:"result"`
+}
+
+// searchRespResult represents result of search request to engine.
+//
+// Some engine forks return it at the top level of response instead of wrapping into searchResp.
+type searchRespResult struct {
+	Total   int            `json:"total"`
+	Results []SearchResult `json:"results"`
+	Time    float64        `json:"time"`
+}
+
+// BenchResult represents search benchmark metrics.
+type BenchResult struct {
+	Pages         int
+	Sources       int
+	Duration      time.Duration
+	PagesPerSec   float64
+	SourcesPerSec float64
+	AvgEngineTime time.Duration
 }
 
 // NewEngine returns new engine handler with it's address at `addr`, which should be in format of 'host:port'.
@@ -152,7 +167,7 @@ func (e Engine) SearchAll(ctx context.Context) ([]SearchResult, error) {
 	e.log.Info("Searching for channels")
 	results := []SearchResult{}
 	for page := 0; ; page++ {
-		currResults, err := e.searchAtPage(ctx, page)
+		currResults, _, err := e.searchAtPage(ctx, page)
 		if err != nil {
 			return results, errors.Wrapf(err, "Search at page %v", page)
 		}
@@ -163,33 +178,89 @@ func (e Engine) SearchAll(ctx context.Context) ([]SearchResult, error) {
 	}
 }
 
-// searchAtPage returns ace stream channels at page `page` with page size defined in engine instance.
-func (e Engine) searchAtPage(ctx context.Context, page int) ([]SearchResult, error) {
+// BenchSearch fetches up to `pages` search pages and returns metrics of how fast engine serves them.
+//
+// Stops earlier if engine has no more pages to serve.
+func (e Engine) BenchSearch(ctx context.Context, pages int) (BenchResult, error) {
+	e.log.InfoFi("Benchmarking search", "pages", pages, "page size", e.pageSize)
+	var out BenchResult
+	var engineTime float64
+	start := time.Now()
+	for page := 0; page < pages; page++ {
+		currResults, currEngineTime, err := e.searchAtPage(ctx, page)
+		if err != nil {
+			return out, errors.Wrapf(err, "Search at page %v", page)
+		}
+		out.Pages++
+		out.Sources += GetSourcesAmount(currResults)
+		engineTime += currEngineTime
+		if len(currResults) < e.pageSize {
+			break
+		}
+	}
+	out.Duration = time.Since(start)
+	if seconds := out.Duration.Seconds(); seconds > 0 {
+		out.PagesPerSec = float64(out.Pages) / seconds
+		out.SourcesPerSec = float64(out.Sources) / seconds
+	}
+	if out.Pages > 0 {
+		out.AvgEngineTime = time.Duration(engineTime / float64(out.Pages) * float64(time.Second))
+	}
+	return out, nil
+}
+
+// searchAtPage returns ace stream channels at page `page` with page size defined in engine instance and time in
+// seconds engine reported to spend on the search.
+func (e Engine) searchAtPage(ctx context.Context, page int) ([]SearchResult, float64, error) {
 	params := url.Values{}
 	params.Set("page_size", fmt.Sprint(e.pageSize))
 	params.Set("page", fmt.Sprint(page))
 	url := url.URL{Scheme: "http", Host: e.addr, Path: "search", RawQuery: params.Encode()}
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
 	if err != nil {
-		return []SearchResult{}, errors.Wrap(err, "Create search request")
+		return []SearchResult{}, 0, errors.Wrap(err, "Create search request")
 	}
 	resp, err := e.httpClient.Do(req)
 	if err != nil {
-		return []SearchResult{}, errors.Wrap(err, "Send search request")
+		return []SearchResult{}, 0, errors.Wrap(err, "Send search request")
 	}
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return []SearchResult{}, errors.Wrap(err, "Read search response body")
+		return []SearchResult{}, 0, errors.Wrap(err, "Read search response body")
 	}
-	var out searchResp
-	err = json.Unmarshal(body, &out)
+	out, err := e.decodeSearchResp(body)
 	if err != nil {
-		return []SearchResult{}, errors.Wrap(err, "Decode search response body as JSON")
+		return []SearchResult{}, 0, errors.Wrap(err, "Decode search response body as JSON")
+	}
+	e.log.InfoFi("Received", "channels", len(out.Results), "sources", GetSourcesAmount(out.Results), "page", page)
+	return out.Results, out.Time, nil
+}
+
+// decodeSearchResp returns search result decoded from search response `body`.
+//
+// Tries to decode results wrapped into 'result' field first, then at the top level of response.
+func (e Engine) decodeSearchResp(body []byte) (searchRespResult, error) {
+	var wrapped searchResp
+	wrappedErr := json.Unmarshal(body, &wrapped)
+	if wrappedErr == nil && len(wrapped.Result.Results) > 0 {
+		e.log.DebugFi("Decoded search response", "shape", "wrapped")
+		return wrapped.Result, nil
+	}
+	var topLevel searchRespResult
+	topLevelErr := json.Unmarshal(body, &topLevel)
+	if topLevelErr == nil && len(topLevel.Results) > 0 {
+		e.log.DebugFi("Decoded search response", "shape", "top level")
+		return topLevel, nil
+	}
+	if wrappedErr != nil && topLevelErr != nil {
+		return searchRespResult{}, wrappedErr
+	}
+	e.log.DebugFi("Decoded search response", "shape", "empty")
+	if wrappedErr == nil {
+		return wrapped.Result, nil
 	}
-	e.log.InfoFi("Received", "channels", len(out.Result.Results), "sources", GetSourcesAmount(out.Result.Results),
-		"page", page)
-	return out.Result.Results, nil
+	return topLevel, nil
 }
 
 // GetSourcesAmount returns total amount of Item's in `searchResults`.
@@ -0,0 +1,124 @@
+package acestream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+
+	"m3u_gen_acestream/util/logger"
+	"m3u_gen_acestream/util/network"
+)
+
+// newSearchStub returns test server serving `pages` full pages of `pageSize` channels with 2 sources each, followed
+// by empty pages. Every response reports `engineTime` seconds spent.
+func newSearchStub(pages, pageSize int, engineTime float64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var page int
+		fmt.Sscan(r.URL.Query().Get("page"), &page)
+		var out searchResp
+		out.Result.Time = engineTime
+		out.Result.Results = []SearchResult{}
+		if page < pages {
+			out.Result.Results = lo.Times(pageSize, func(idx int) SearchResult {
+				return SearchResult{Items: []Item{{Name: fmt.Sprint(idx)}, {Name: fmt.Sprint(idx)}}}
+			})
+		}
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+}
+
+func TestBenchSearch(t *testing.T) {
+	var consoleBuff bytes.Buffer
+	log := logger.New(logger.DebugLevel, &consoleBuff)
+
+	server := newSearchStub(3, 10, 0.25)
+	defer server.Close()
+
+	engine := NewEngine(log, network.NewHTTPClient(time.Second*5), strings.TrimPrefix(server.URL, "http://"))
+	engine.pageSize = 10
+
+	bench, err := engine.BenchSearch(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, bench.Pages, "Should stop at requested amount of pages")
+	assert.Equal(t, 40, bench.Sources)
+	assert.Equal(t, time.Millisecond*250, bench.AvgEngineTime)
+	assert.Positive(t, bench.Duration)
+	assert.InDelta(t, float64(bench.Pages)/bench.Duration.Seconds(), bench.PagesPerSec, 0.001)
+	assert.InDelta(t, float64(bench.Sources)/bench.Duration.Seconds(), bench.SourcesPerSec, 0.001)
+	assert.InDelta(t, bench.PagesPerSec*20, bench.SourcesPerSec, 0.001)
+
+	bench, err = engine.BenchSearch(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, bench.Pages, "Should stop at the first not full page")
+	assert.Equal(t, 60, bench.Sources)
+}
+
+func TestSearchAtPage(t *testing.T) {
+	var consoleBuff bytes.Buffer
+	log := logger.New(logger.DebugLevel, &consoleBuff)
+
+	timeRx := `[0-9]{4}-[0-9]{2}-[0-9]{2} [0-9]{2}:[0-9]{2}:[0-9]{2}`
+	items := `{"items": [{"name": "name 1", "infohash": "1"}, {"name": "name 2", "infohash": "2"}], "name": "name"}`
+	expected := []SearchResult{
+		{Items: []Item{{Name: "name 1", Infohash: "1"}, {Name: "name 2", Infohash: "2"}}, Name: "name"},
+	}
+
+	tests := map[string]struct {
+		body     string
+		expected []SearchResult
+		time     float64
+		logLine  string
+	}{
+		"results wrapped into result": {
+			body:     `{"result": {"total": 1, "results": [` + items + `], "time": 0.5}}`,
+			expected: expected,
+			time:     0.5,
+			logLine:  timeRx + ` DEBUG Decoded search response: shape "wrapped"`,
+		},
+		"results at the top level": {
+			body:     `{"total": 1, "results": [` + items + `], "time": 0.5}`,
+			expected: expected,
+			time:     0.5,
+			logLine:  timeRx + ` DEBUG Decoded search response: shape "top level"`,
+		},
+		"no results": {
+			body:     `{"result": {"total": 0, "results": [], "time": 0.5}}`,
+			expected: []SearchResult{},
+			time:     0.5,
+			logLine:  timeRx + ` DEBUG Decoded search response: shape "empty"`,
+		},
+	}
+
+	for name, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, test.body)
+		}))
+		engine := NewEngine(log, network.NewHTTPClient(time.Second*5), strings.TrimPrefix(server.URL, "http://"))
+
+		actual, engineTime, err := engine.searchAtPage(context.Background(), 0)
+		assert.NoError(t, err, fmt.Sprintf("Unexpected error in test '%v'", name))
+		assert.ElementsMatch(t, test.expected, actual, fmt.Sprintf("Bad returned value in test '%v'", name))
+		assert.Exactly(t, test.time, engineTime, fmt.Sprintf("Bad returned engine time in test '%v'", name))
+		assert.Regexp(t, test.logLine, consoleBuff.String(), fmt.Sprintf("Bad log output in test '%v'", name))
+
+		server.Close()
+		consoleBuff.Reset()
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `not json`)
+	}))
+	defer server.Close()
+	engine := NewEngine(log, network.NewHTTPClient(time.Second*5), strings.TrimPrefix(server.URL, "http://"))
+	_, _, err := engine.searchAtPage(context.Background(), 0)
+	assert.Error(t, err, "Should fail to decode invalid JSON")
+}
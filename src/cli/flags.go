@@ -8,11 +8,14 @@ import (
 
 // Flags represents command line flags.
 type Flags struct {
-	Version  bool       `short:"v" long:"version" description:"Print the program version"`
-	Update   bool       `short:"u" long:"update" description:"Check for updates and update"`
-	LogLevel pLog.Level `short:"l" long:"logLevel" description:"Logging level. Can be from 1 (most verbose) to 7 (least verbose)"`
-	LogFile  string     `short:"f" long:"logFile" description:"Log file. If set, writes structured log to a file at the specified path"`
-	CfgPath  string     `short:"c" long:"cfgPath" description:"Config file path to read from or initialize a default"`
+	Version     bool       `short:"v" long:"version" description:"Print the program version"`
+	Update      bool       `short:"u" long:"update" description:"Check for updates and update"`
+	LogLevel    pLog.Level `short:"l" long:"logLevel" description:"Logging level. Can be from 1 (most verbose) to 7 (least verbose)"`
+	LogFile     string     `short:"f" long:"logFile" description:"Log file. If set, writes structured log to a file at the specified path"`
+	CfgPath     string     `short:"c" long:"cfgPath" description:"Config file path to read from or initialize a default"`
+	BenchSearch int        `long:"benchSearch" description:"If set, fetch that many search pages, print engine search speed as tab-separated values and exit"`
+	Preview     bool       `long:"preview" description:"Print channels each playlist would contain as tab-separated values and exit without removing dead sources and writing playlists"`
+	SummaryJSON bool       `long:"summaryJSON" description:"Print run summary with timings and counts as a single line JSON object to stderr"`
 }
 
 // Parse returns a structure initialized with command line arguments and error if parsing failed.
@@ -25,11 +25,15 @@ type Config struct {
 type Playlist struct {
 	OutputPath                   string              `yaml:"outputPath"`
 	HeaderTemplate               string              `yaml:"headerTemplate"`
+	PlaylistTitle                *string             `yaml:"playlistTitle"`
+	EmitCountComment             *bool               `yaml:"emitCountComment"`
 	EntryTemplate                string              `yaml:"entryTemplate"`
+	RelativeLinks                *bool               `yaml:"relativeLinks"`
 	CategoryRxToCategoryMap      map[string]string   `yaml:"categoryRxToCategoryMap"`
 	NameRxToCategoriesMap        map[string][]string `yaml:"nameRxToCategoriesMap"`
 	NameRxFilter                 []string            `yaml:"nameRxFilter"`
 	NameRxBlacklist              []string            `yaml:"nameRxBlacklist"`
+	MatchNormalizedName          *bool               `yaml:"matchNormalizedName"`
 	CategoriesFilter             []string            `yaml:"categoriesFilter"`
 	CategoriesFilterStrict       bool                `yaml:"categoriesFilterStrict"`
 	CategoriesBlacklist          []string            `yaml:"categoriesBlacklist"`
@@ -42,6 +46,9 @@ type Playlist struct {
 	StatusFilter                 []int               `yaml:"statusFilter"`
 	AvailabilityThreshold        float64             `yaml:"availabilityThreshold"`
 	AvailabilityUpdatedThreshold time.Duration       `yaml:"availabilityUpdatedThreshold"`
+	MaxSourcesPerName            *int                `yaml:"maxSourcesPerName"`
+	ExcludeInfohashesFrom        []string            `yaml:"excludeInfohashesFrom"`
+	MergeByNormalizedName        *bool               `yaml:"mergeByNormalizedName"`
 	RemoveDeadSources            *bool               `yaml:"removeDeadSources"`
 	UseMpegTsAnalyzer            *bool               `yaml:"useMpegTsAnalyzer"`
 	CheckRespTimeout             *time.Duration      `yaml:"checkRespTimeout"`
@@ -78,6 +85,10 @@ func Init(log *logger.Logger, filePath string) (*Config, bool, error) {
 	}
 
 	validateConfig := func() error {
+		outputPathToIdxMap := map[string]int{}
+		for idx, playlist := range cfg.Playlists {
+			outputPathToIdxMap[playlist.OutputPath] = idx
+		}
 		for _, playlist := range cfg.Playlists {
 			for rx := range playlist.CategoryRxToCategoryMap {
 				if _, err := regexp2.Compile(rx, regexp2.RE2); err != nil {
@@ -99,6 +110,15 @@ func Init(log *logger.Logger, filePath string) (*Config, bool, error) {
 					return errors.Wrapf(err, "Can not compile regular expression:\n%v\nin nameRxBlacklist", rx)
 				}
 			}
+			if playlist.MaxSourcesPerName != nil && *playlist.MaxSourcesPerName < 0 {
+				return errors.Newf("maxSourcesPerName can not be negative, got %v", *playlist.MaxSourcesPerName)
+			}
+			for _, outputPath := range playlist.ExcludeInfohashesFrom {
+				if _, ok := outputPathToIdxMap[outputPath]; !ok {
+					return errors.Newf("Playlist %v in excludeInfohashesFrom of %v not found", outputPath,
+						playlist.OutputPath)
+				}
+			}
 			if _, err := template.New("").Parse(playlist.EntryTemplate); err != nil {
 				return errors.Wrapf(err, "Can not parse template:\n%v\nin entryTemplate", playlist.EntryTemplate)
 			}
@@ -107,12 +127,85 @@ func Init(log *logger.Logger, filePath string) (*Config, bool, error) {
 					playlist.EntryTemplate)
 			}
 		}
+		// Detect cycles in excludeInfohashesFrom.
+		visitState := make([]int, len(cfg.Playlists)) // 0 - not visited, 1 - in progress, 2 - done.
+		var visit func(idx int) error
+		visit = func(idx int) error {
+			switch visitState[idx] {
+			case 1:
+				return errors.Newf("Playlist %v excludes infohashes from itself through excludeInfohashesFrom",
+					cfg.Playlists[idx].OutputPath)
+			case 2:
+				return nil
+			}
+			visitState[idx] = 1
+			for _, outputPath := range cfg.Playlists[idx].ExcludeInfohashesFrom {
+				if err := visit(outputPathToIdxMap[outputPath]); err != nil {
+					return err
+				}
+			}
+			visitState[idx] = 2
+			return nil
+		}
+		for idx := range cfg.Playlists {
+			if err := visit(idx); err != nil {
+				return err
+			}
+		}
 		return nil
 	}
 
 	addNewOptions := func() error {
 		modified := false
 		for idx, playlist := range cfg.Playlists {
+			if playlist.PlaylistTitle == nil {
+				defVal := lo.ToPtr("")
+				path := fmt.Sprintf("$.playlists[%v].playlistTitle", idx)
+				log.InfoFi("Adding new config option", "path", path, "value", defVal, "playlist", playlist.OutputPath)
+				cfg.Playlists[idx].PlaylistTitle = defVal
+				commentMap[path] = defCommentMap[path]
+				modified = true
+			}
+			if playlist.EmitCountComment == nil {
+				defVal := lo.ToPtr(false)
+				path := fmt.Sprintf("$.playlists[%v].emitCountComment", idx)
+				log.InfoFi("Adding new config option", "path", path, "value", defVal, "playlist", playlist.OutputPath)
+				cfg.Playlists[idx].EmitCountComment = defVal
+				commentMap[path] = defCommentMap[path]
+				modified = true
+			}
+			if playlist.RelativeLinks == nil {
+				defVal := lo.ToPtr(false)
+				path := fmt.Sprintf("$.playlists[%v].relativeLinks", idx)
+				log.InfoFi("Adding new config option", "path", path, "value", defVal, "playlist", playlist.OutputPath)
+				cfg.Playlists[idx].RelativeLinks = defVal
+				commentMap[path] = defCommentMap[path]
+				modified = true
+			}
+			if playlist.MatchNormalizedName == nil {
+				defVal := lo.ToPtr(false)
+				path := fmt.Sprintf("$.playlists[%v].matchNormalizedName", idx)
+				log.InfoFi("Adding new config option", "path", path, "value", defVal, "playlist", playlist.OutputPath)
+				cfg.Playlists[idx].MatchNormalizedName = defVal
+				commentMap[path] = defCommentMap[path]
+				modified = true
+			}
+			if playlist.MaxSourcesPerName == nil {
+				defVal := lo.ToPtr(0)
+				path := fmt.Sprintf("$.playlists[%v].maxSourcesPerName", idx)
+				log.InfoFi("Adding new config option", "path", path, "value", defVal, "playlist", playlist.OutputPath)
+				cfg.Playlists[idx].MaxSourcesPerName = defVal
+				commentMap[path] = defCommentMap[path]
+				modified = true
+			}
+			if playlist.MergeByNormalizedName == nil {
+				defVal := lo.ToPtr(false)
+				path := fmt.Sprintf("$.playlists[%v].mergeByNormalizedName", idx)
+				log.InfoFi("Adding new config option", "path", path, "value", defVal, "playlist", playlist.OutputPath)
+				cfg.Playlists[idx].MergeByNormalizedName = defVal
+				commentMap[path] = defCommentMap[path]
+				modified = true
+			}
 			if playlist.RemoveDeadSources == nil {
 				defVal := lo.ToPtr(false)
 				path := fmt.Sprintf("$.playlists[%v].removeDeadSources", idx)
@@ -202,11 +295,15 @@ func newDefCfg() (*Config, yaml.CommentMap) {
 			{
 				OutputPath:                   "./out/playlist_mpegts_all.m3u8",
 				HeaderTemplate:               headerLine,
+				PlaylistTitle:                lo.ToPtr(""),
+				EmitCountComment:             lo.ToPtr(false),
 				EntryTemplate:                entryLine1 + entryMpegtsLink,
+				RelativeLinks:                lo.ToPtr(false),
 				CategoryRxToCategoryMap:      map[string]string{regexpNonDefault: "other"},
 				NameRxToCategoriesMap:        map[string][]string{},
 				NameRxFilter:                 []string{},
 				NameRxBlacklist:              []string{},
+				MatchNormalizedName:          lo.ToPtr(false),
 				CategoriesFilter:             []string{},
 				CategoriesFilterStrict:       false,
 				CategoriesBlacklist:          []string{},
@@ -219,6 +316,9 @@ func newDefCfg() (*Config, yaml.CommentMap) {
 				StatusFilter:                 []int{2},
 				AvailabilityThreshold:        1.0,
 				AvailabilityUpdatedThreshold: time.Hour * 12 * 3,
+				MaxSourcesPerName:            lo.ToPtr(0),
+				ExcludeInfohashesFrom:        []string{},
+				MergeByNormalizedName:        lo.ToPtr(false),
 				RemoveDeadSources:            lo.ToPtr(false),
 				UseMpegTsAnalyzer:            lo.ToPtr(false),
 				CheckRespTimeout:             lo.ToPtr(time.Second * 20),
@@ -228,11 +328,15 @@ func newDefCfg() (*Config, yaml.CommentMap) {
 			{
 				OutputPath:                   "./out/playlist_hls_tv_+_music_+_no_category.m3u8",
 				HeaderTemplate:               headerLine,
+				PlaylistTitle:                lo.ToPtr(""),
+				EmitCountComment:             lo.ToPtr(false),
 				EntryTemplate:                entryLine1 + entryHlsLink,
+				RelativeLinks:                lo.ToPtr(false),
 				CategoryRxToCategoryMap:      map[string]string{`(?i)^tv$`: "television", `^$`: "unknown"},
 				NameRxToCategoriesMap:        map[string][]string{},
 				NameRxFilter:                 []string{},
 				NameRxBlacklist:              []string{},
+				MatchNormalizedName:          lo.ToPtr(false),
 				CategoriesFilter:             []string{"tv", "music", "unknown"},
 				CategoriesFilterStrict:       false,
 				CategoriesBlacklist:          []string{},
@@ -245,6 +349,9 @@ func newDefCfg() (*Config, yaml.CommentMap) {
 				StatusFilter:                 []int{2},
 				AvailabilityThreshold:        1.0,
 				AvailabilityUpdatedThreshold: time.Hour * 12 * 3,
+				MaxSourcesPerName:            lo.ToPtr(0),
+				ExcludeInfohashesFrom:        []string{},
+				MergeByNormalizedName:        lo.ToPtr(false),
 				RemoveDeadSources:            lo.ToPtr(false),
 				UseMpegTsAnalyzer:            lo.ToPtr(false),
 				CheckRespTimeout:             lo.ToPtr(time.Second * 20),
@@ -254,11 +361,15 @@ func newDefCfg() (*Config, yaml.CommentMap) {
 			{
 				OutputPath:                   "./out/playlist_httpaceproxy_all_but_porn.m3u8",
 				HeaderTemplate:               headerLine,
+				PlaylistTitle:                lo.ToPtr(""),
+				EmitCountComment:             lo.ToPtr(false),
 				EntryTemplate:                entryLine1 + entryHttpAceProxyLink,
+				RelativeLinks:                lo.ToPtr(false),
 				CategoryRxToCategoryMap:      map[string]string{},
 				NameRxToCategoriesMap:        map[string][]string{},
 				NameRxFilter:                 []string{},
 				NameRxBlacklist:              []string{`(?i).*erotic.*`, `(?i).*porn.*`, `(?i).*18\+.*`},
+				MatchNormalizedName:          lo.ToPtr(false),
 				CategoriesFilter:             []string{},
 				CategoriesFilterStrict:       false,
 				CategoriesBlacklist:          []string{"erotic_18_plus", "18+"},
@@ -271,6 +382,9 @@ func newDefCfg() (*Config, yaml.CommentMap) {
 				StatusFilter:                 []int{2},
 				AvailabilityThreshold:        1.0,
 				AvailabilityUpdatedThreshold: time.Hour * 12 * 3,
+				MaxSourcesPerName:            lo.ToPtr(0),
+				ExcludeInfohashesFrom:        []string{},
+				MergeByNormalizedName:        lo.ToPtr(false),
 				RemoveDeadSources:            lo.ToPtr(false),
 				UseMpegTsAnalyzer:            lo.ToPtr(false),
 				CheckRespTimeout:             lo.ToPtr(time.Second * 20),
@@ -300,6 +414,20 @@ func newDefCfg() (*Config, yaml.CommentMap) {
 		"$.playlists[0].headerTemplate": []*yaml.Comment{
 			yaml.HeadComment("", " Template for the header of M3U file."),
 		},
+		"$.playlists[0].playlistTitle": []*yaml.Comment{
+			yaml.HeadComment(
+				"",
+				" If not empty, write '#PLAYLIST:<playlistTitle>' line after the header.",
+				" Some players display it as the playlist title.",
+			),
+		},
+		"$.playlists[0].emitCountComment": []*yaml.Comment{
+			yaml.HeadComment(
+				"",
+				" If true, write '# channels: <amount>, generated: <time>' comment line after the header.",
+				" Amount is the amount of distinct channel names, not sources.",
+			),
+		},
 		"$.playlists[0].entryTemplate": []*yaml.Comment{
 			yaml.HeadComment(
 				"",
@@ -312,6 +440,21 @@ func newDefCfg() (*Config, yaml.CommentMap) {
 				" {{.EngineAddr}}",
 				" {{.TVGName}}",
 				" {{.IconURL}}",
+				" {{.Availability}}",
+				" {{.AvailabilityUpdatedAt}} - availability update time as unix timestamp.",
+				" {{.AvailabilityUpdatedAgoSeconds}} - seconds passed since availability update.",
+				" {{.AvailabilityUpdatedAgo}} - time passed since availability update, such as '1h2m3s'.",
+				" Example of entry template to write CSV:",
+				" entryTemplate: |",
+				"   {{.Infohash}},{{.AvailabilityUpdatedAt}},{{.AvailabilityUpdatedAgoSeconds}},{{.AvailabilityUpdatedAgo}}",
+			),
+		},
+		"$.playlists[0].relativeLinks": []*yaml.Comment{
+			yaml.HeadComment(
+				"",
+				" If true, {{.EngineAddr}} is empty and links such as 'http://{{.EngineAddr}}/ace/getstream'",
+				" become root-relative, such as '/ace/getstream'. Useful if playlist is loaded through the same",
+				" reverse proxy as engine. Dead sources are still checked using `engineAddr`.",
 			),
 		},
 		"$.playlists[0].categoryRxToCategoryMap": []*yaml.Comment{
@@ -359,6 +502,14 @@ func newDefCfg() (*Config, yaml.CommentMap) {
 				" - '.*remove channels matching name B.*'",
 			),
 		},
+		"$.playlists[0].matchNormalizedName": []*yaml.Comment{
+			yaml.HeadComment(
+				"",
+				" If true, match `nameRxFilter` and `nameRxBlacklist` against channel names in lower case, without",
+				" diacritics and emojis and with full-width characters folded, so 'ＨＢＯ' matches '^hbo$'.",
+				" Channel names in playlist stay unchanged.",
+			),
+		},
 		"$.playlists[0].categoriesFilter": []*yaml.Comment{
 			yaml.HeadComment(
 				"",
@@ -477,6 +628,34 @@ func newDefCfg() (*Config, yaml.CommentMap) {
 				" The lower this value is, the more channels gets removed.",
 			),
 		},
+		"$.playlists[0].maxSourcesPerName": []*yaml.Comment{
+			yaml.HeadComment(
+				"",
+				" Remove all channels which name has more sources than this.",
+				" Hundreds of sources under the same name usually are spam.",
+				" Set to 0 to keep any amount of sources.",
+			),
+		},
+		"$.playlists[0].excludeInfohashesFrom": []*yaml.Comment{
+			yaml.HeadComment(
+				"",
+				" Remove sources which infohashes are written to any of these playlists (values of `outputPath`),",
+				" regardless of the order of playlists.",
+				" Example:",
+				" excludeInfohashesFrom:",
+				" - './out/playlist A.m3u8'",
+				" - './out/playlist B.m3u8'",
+			),
+		},
+		"$.playlists[0].mergeByNormalizedName": []*yaml.Comment{
+			yaml.HeadComment(
+				"",
+				" If true, merge channels which names are equal in lower case, without diacritics and emojis, with",
+				" full-width characters folded and repeating spaces removed, such as 'HBO HD' and 'hbo  hd'.",
+				" Merged channel has an entry for every distinct infohash, sorted by availability, all with the name and",
+				" categories of the source with the highest availability.",
+			),
+		},
 		"$.playlists[0].removeDeadSources": []*yaml.Comment{
 			yaml.HeadComment(
 				"",
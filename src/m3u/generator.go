@@ -2,6 +2,9 @@ package m3u
 
 import (
 	"bytes"
+	"cmp"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"slices"
@@ -17,8 +20,10 @@ import (
 
 	"m3u_gen_acestream/acestream"
 	"m3u_gen_acestream/config"
+	"m3u_gen_acestream/stats"
 	"m3u_gen_acestream/util/logger"
 	"m3u_gen_acestream/util/maps"
+	"m3u_gen_acestream/util/text"
 )
 
 // Entry represents M3U file entry to execute template on.
@@ -31,80 +36,307 @@ type Entry struct {
 	EngineAddr string
 	TVGName    string
 	IconURL    string
+
+	Availability                  float64
+	AvailabilityUpdatedAt         int64
+	AvailabilityUpdatedAgoSeconds int64
+	AvailabilityUpdatedAgo        string
 }
 
 // Generate writes M3U file based on filtered `searchResults` using settings in config `cfg`.
-func Generate(log *logger.Logger, searchResults []acestream.SearchResult, cfg *config.Config) error {
+//
+// Time spent on removing dead sources and amount of written sources are added to `st`.
+func Generate(log *logger.Logger,
+	searchResults []acestream.SearchResult,
+	cfg *config.Config,
+	st *stats.Stats) error {
 	log.Info("Generating M3U files")
 
 	infohashCheckErrorMap := &sync.Map{}
 
-	for _, playlist := range cfg.Playlists {
-		searchResults := remap(log, searchResults, playlist)
-		searchResults = filter(log, searchResults, playlist)
+	// Same time reference for filtering by availability update time and for availability update age in entries.
+	now := time.Now()
+
+	return excludeInfohashes(log, cfg.Playlists, func(idx int) []Entry {
+		playlist := cfg.Playlists[idx]
+		searchResults := transform(log, searchResults, playlist, now)
 		if *playlist.RemoveDeadSources {
+			stopPhase := st.StartPhase("remove_dead")
 			searchResults = removeDead(log, searchResults, playlist, cfg.EngineAddr, infohashCheckErrorMap)
+			stopPhase()
+		}
+		// Dead sources are checked with the absolute address above, only links in playlist are relative.
+		engineAddr := cfg.EngineAddr
+		if lo.FromPtr(playlist.RelativeLinks) {
+			engineAddr = ""
+		}
+		return toEntries(searchResults, engineAddr, now)
+	}, func(idx int, entries []Entry) error {
+		playlist := cfg.Playlists[idx]
+		if lo.FromPtr(playlist.MergeByNormalizedName) {
+			entries = mergeByNormalizedName(log, entries, playlist)
 		}
+		if err := write(log, entries, playlist, now); err != nil {
+			return err
+		}
+		st.SetWritten(playlist.OutputPath, len(entries))
+		return nil
+	})
+}
 
-		// Transform []SearchResult to []Entry.
-		entries := lo.FlatMap(searchResults, func(sr acestream.SearchResult, _ int) []Entry {
-			iconURLs := lo.Map(sr.Icons, func(icon acestream.Icon, _ int) string {
-				return icon.URL
-			})
-			return lo.Map(sr.Items, func(item acestream.Item, _ int) Entry {
-				categories := lo.Compact(lo.Uniq(lo.Map(item.Categories, func(category string, _ int) string {
-					return strings.ToLower(category)
-				})))
-				countries := lo.Compact(lo.Uniq(lo.Map(item.Countries, func(country string, _ int) string {
-					return strings.ToLower(country)
-				})))
-				languages := lo.Compact(lo.Uniq(lo.Map(item.Languages, func(language string, _ int) string {
-					return strings.ToLower(language)
-				})))
-				slices.Sort(categories)
-				slices.Sort(countries)
-				slices.Sort(languages)
-
-				return Entry{
-					Name:       item.Name,
-					Infohash:   item.Infohash,
-					Categories: strings.Join(categories, ";"),
-					Countries:  strings.Join(countries, ";"),
-					Languages:  strings.Join(languages, ";"),
-					EngineAddr: cfg.EngineAddr,
-					TVGName:    strings.ReplaceAll(item.Name, " ", "_"),
-					IconURL:    lo.FirstOr(iconURLs, ""),
-				}
-			})
+// Preview writes names of channels and amount of their sources each playlist in `cfg` would contain to `w` as
+// tab-separated values, without removing dead sources and writing playlists. Channels of every playlist are followed
+// by a row with empty name and total amount of sources in the playlist.
+func Preview(log *logger.Logger, searchResults []acestream.SearchResult, cfg *config.Config, w io.Writer) error {
+	log.Info("Previewing M3U files")
+
+	now := time.Now()
+
+	if _, err := fmt.Fprintln(w, "playlist\tname\tsources"); err != nil {
+		return errors.Wrap(err, "Write preview header")
+	}
+
+	return excludeInfohashes(log, cfg.Playlists, func(idx int) []Entry {
+		return toEntries(transform(log, searchResults, cfg.Playlists[idx], now), cfg.EngineAddr, now)
+	}, func(idx int, entries []Entry) error {
+		playlist := cfg.Playlists[idx]
+		if lo.FromPtr(playlist.MergeByNormalizedName) {
+			entries = mergeByNormalizedName(log, entries, playlist)
+		}
+		names := lo.Uniq(lo.Map(entries, func(entry Entry, _ int) string {
+			return entry.Name
+		}))
+		nameSourcesMap := lo.CountValuesBy(entries, func(entry Entry) string {
+			return entry.Name
 		})
+		for _, name := range names {
+			if _, err := fmt.Fprintf(w, "%v\t%v\t%v\n", playlist.OutputPath, name, nameSourcesMap[name]); err != nil {
+				return errors.Wrapf(err, "Write preview of playlist %v", playlist.OutputPath)
+			}
+		}
+		// Total row with empty name, so playlist without channels is still listed.
+		if _, err := fmt.Fprintf(w, "%v\t\t%v\n", playlist.OutputPath, len(entries)); err != nil {
+			return errors.Wrapf(err, "Write preview of playlist %v", playlist.OutputPath)
+		}
+		return nil
+	})
+}
 
-		// Sort entries by names and categories.
-		slices.SortStableFunc(entries, func(a, b Entry) int {
-			return strings.Compare(a.Name, b.Name)
+// transform returns `searchResults` remapped and filtered by criterias in `playlist`.
+//
+// `now` is the time reference for availability update time.
+func transform(log *logger.Logger,
+	searchResults []acestream.SearchResult,
+	playlist config.Playlist,
+	now time.Time) []acestream.SearchResult {
+	searchResults = remap(log, searchResults, playlist)
+	return filter(log, searchResults, playlist, now)
+}
+
+// toEntries returns `searchResults` transformed to sorted entries with Ace Stream Engine address `engineAddr`.
+//
+// Availability update age is calculated relative to `now`.
+func toEntries(searchResults []acestream.SearchResult, engineAddr string, now time.Time) []Entry {
+	entries := lo.FlatMap(searchResults, func(sr acestream.SearchResult, _ int) []Entry {
+		iconURLs := lo.Map(sr.Icons, func(icon acestream.Icon, _ int) string {
+			return icon.URL
 		})
-		slices.SortStableFunc(entries, func(a, b Entry) int {
-			return strings.Compare(a.Categories, b.Categories)
+		return lo.Map(sr.Items, func(item acestream.Item, _ int) Entry {
+			categories := lo.Compact(lo.Uniq(lo.Map(item.Categories, func(category string, _ int) string {
+				return strings.ToLower(category)
+			})))
+			countries := lo.Compact(lo.Uniq(lo.Map(item.Countries, func(country string, _ int) string {
+				return strings.ToLower(country)
+			})))
+			languages := lo.Compact(lo.Uniq(lo.Map(item.Languages, func(language string, _ int) string {
+				return strings.ToLower(language)
+			})))
+			slices.Sort(categories)
+			slices.Sort(countries)
+			slices.Sort(languages)
+			availabilityUpdatedAgo := now.Unix() - item.AvailabilityUpdatedAt
+
+			return Entry{
+				Name:       item.Name,
+				Infohash:   item.Infohash,
+				Categories: strings.Join(categories, ";"),
+				Countries:  strings.Join(countries, ";"),
+				Languages:  strings.Join(languages, ";"),
+				EngineAddr: engineAddr,
+				TVGName:    strings.ReplaceAll(item.Name, " ", "_"),
+				IconURL:    lo.FirstOr(iconURLs, ""),
+
+				Availability:                  item.Availability,
+				AvailabilityUpdatedAt:         item.AvailabilityUpdatedAt,
+				AvailabilityUpdatedAgoSeconds: availabilityUpdatedAgo,
+				AvailabilityUpdatedAgo:        (time.Duration(availabilityUpdatedAgo) * time.Second).String(),
+			}
 		})
+	})
+
+	// Sort entries by names and categories.
+	slices.SortStableFunc(entries, func(a, b Entry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	slices.SortStableFunc(entries, func(a, b Entry) int {
+		return strings.Compare(a.Categories, b.Categories)
+	})
 
-		// Write playlists.
-		log.InfoFi("Writing output", "playlist", playlist.OutputPath)
-		if err := os.MkdirAll(filepath.Dir(playlist.OutputPath), os.ModePerm); err != nil {
-			return errors.Wrapf(err, "Make directory structure for playlist %v", playlist.OutputPath)
+	return entries
+}
+
+// excludeInfohashes calls `doneFn` with entries of every playlist in `playlists` as soon as they are resolved.
+//
+// Entries of playlist are returned by `entriesFn` and have no infohashes written to playlists listed in it's
+// `ExcludeInfohashesFrom`, so these playlists are resolved first. Other playlists are resolved in the order of
+// `playlists`. Stops at the first error returned by `doneFn`.
+func excludeInfohashes(log *logger.Logger,
+	playlists []config.Playlist,
+	entriesFn func(idx int) []Entry,
+	doneFn func(idx int, entries []Entry) error) error {
+	out := make([][]Entry, len(playlists))
+	resolved := make([]bool, len(playlists))
+
+	// Resolve playlists recursively, so exclusion does not depend on the order of playlists.
+	// Config validation guarantees every playlist to exclude infohashes from exists and there are no cycles.
+	var resolve func(idx int) error
+	resolve = func(idx int) error {
+		if resolved[idx] {
+			return nil
 		}
-		var buff bytes.Buffer
-		buff.WriteString(playlist.HeaderTemplate)
-		templ := template.Must(template.New("").Parse(playlist.EntryTemplate))
-		for _, entry := range entries {
-			if err := templ.Execute(&buff, entry); err != nil {
-				return errors.Wrapf(err, "Execute template for entry %+v", entry)
+		resolved[idx] = true
+		playlist := playlists[idx]
+		otherIdxs := lo.Map(playlist.ExcludeInfohashesFrom, func(outputPath string, _ int) int {
+			return slices.IndexFunc(playlists, func(other config.Playlist) bool {
+				return other.OutputPath == outputPath
+			})
+		})
+		for _, otherIdx := range otherIdxs {
+			if err := resolve(otherIdx); err != nil {
+				return err
 			}
 		}
-		if err := os.WriteFile(playlist.OutputPath, buff.Bytes(), 0644); err != nil {
-			return errors.Wrapf(err, "Write playlist file %v", playlist.OutputPath)
+		entries := entriesFn(idx)
+		for _, otherIdx := range otherIdxs {
+			outputPath := playlists[otherIdx].OutputPath
+			excluded := lo.SliceToMap(out[otherIdx], func(entry Entry) (string, struct{}) {
+				return entry.Infohash, struct{}{}
+			})
+			prevSources := len(entries)
+			entries = lo.Reject(entries, func(entry Entry, _ int) bool {
+				_, reject := excluded[entry.Infohash]
+				if reject {
+					log.DebugFi("Rejected", "name", entry.Name, "infohash", entry.Infohash, "written to", outputPath,
+						"playlist", playlist.OutputPath)
+				}
+				return reject
+			})
+			log.InfoFi("Rejected", "sources", prevSources-len(entries), "by", "infohashes written to "+outputPath,
+				"playlist", playlist.OutputPath)
 		}
-		log.InfoFi("Written", "sources", len(entries), "playlist", playlist.OutputPath)
+		out[idx] = entries
+		return doneFn(idx, entries)
 	}
 
+	for idx := range playlists {
+		if err := resolve(idx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeByNormalizedName returns `entries` where entries with equal normalized names are merged into one channel of
+// `playlist`.
+//
+// Merged channel has one entry for every distinct infohash, sorted by availability. All of them have name, categories,
+// countries, languages and icon of the entry with the highest availability. Position of merged channel is the position
+// of the first of merged entries.
+func mergeByNormalizedName(log *logger.Logger, entries []Entry, playlist config.Playlist) []Entry {
+	groups := lo.GroupBy(entries, func(entry Entry) string {
+		return text.Normalize(entry.Name)
+	})
+	var merged []Entry
+	var channels int
+	for _, entry := range entries {
+		normName := text.Normalize(entry.Name)
+		group, ok := groups[normName]
+		if !ok {
+			// Already merged.
+			continue
+		}
+		delete(groups, normName)
+		channels++
+		slices.SortStableFunc(group, func(a, b Entry) int {
+			return cmp.Compare(b.Availability, a.Availability)
+		})
+		best := group[0]
+		sources := lo.Map(lo.UniqBy(group, func(entry Entry) string {
+			return entry.Infohash
+		}), func(source Entry, _ int) Entry {
+			source.Name = best.Name
+			source.TVGName = best.TVGName
+			source.Categories = best.Categories
+			source.Countries = best.Countries
+			source.Languages = best.Languages
+			source.IconURL = best.IconURL
+			return source
+		})
+		if len(group) > 1 {
+			log.DebugFi("Merged", "names", lo.Uniq(lo.Map(group, func(entry Entry, _ int) string {
+				return entry.Name
+			})), "into", best.Name, "sources", len(sources), "playlist", playlist.OutputPath)
+		}
+		merged = append(merged, sources...)
+	}
+	log.InfoFi("Merged", "channels", len(lo.Uniq(lo.Map(entries, func(entry Entry, _ int) string {
+		return entry.Name
+	})))-channels, "by", "normalized name", "playlist", playlist.OutputPath)
+	return merged
+}
+
+// write writes `entries` to M3U file using settings in `playlist`.
+//
+// `now` is written as generation time if `playlist` has count comment enabled.
+func write(log *logger.Logger, entries []Entry, playlist config.Playlist, now time.Time) error {
+	log.InfoFi("Writing output", "playlist", playlist.OutputPath)
+	if err := os.MkdirAll(filepath.Dir(playlist.OutputPath), os.ModePerm); err != nil {
+		return errors.Wrapf(err, "Make directory structure for playlist %v", playlist.OutputPath)
+	}
+	var buff bytes.Buffer
+	buff.WriteString(playlist.HeaderTemplate)
+	if lo.FromPtr(playlist.PlaylistTitle) != "" || lo.FromPtr(playlist.EmitCountComment) {
+		if buff.Len() > 0 && !strings.HasSuffix(buff.String(), "\n") {
+			buff.WriteString("\n")
+		}
+	}
+	if title := lo.FromPtr(playlist.PlaylistTitle); title != "" {
+		buff.WriteString("#PLAYLIST:" + title + "\n")
+	}
+	if lo.FromPtr(playlist.EmitCountComment) {
+		channels := len(lo.UniqBy(entries, func(entry Entry) string {
+			return entry.Name
+		}))
+		buff.WriteString(fmt.Sprintf("# channels: %v, generated: %v\n", channels, now.Format(time.RFC3339)))
+	}
+	templ := template.Must(template.New("").Parse(playlist.EntryTemplate))
+	// Links with empty engine address such as 'http:///ace/getstream' become root-relative '/ace/getstream'.
+	relativeLinkReplacer := strings.NewReplacer("http:///", "/", "https:///", "/")
+	for _, entry := range entries {
+		var entryBuff bytes.Buffer
+		if err := templ.Execute(&entryBuff, entry); err != nil {
+			return errors.Wrapf(err, "Execute template for entry %+v", entry)
+		}
+		if lo.FromPtr(playlist.RelativeLinks) {
+			buff.WriteString(relativeLinkReplacer.Replace(entryBuff.String()))
+		} else {
+			buff.Write(entryBuff.Bytes())
+		}
+	}
+	if err := os.WriteFile(playlist.OutputPath, buff.Bytes(), 0644); err != nil {
+		return errors.Wrapf(err, "Write playlist file %v", playlist.OutputPath)
+	}
+	log.InfoFi("Written", "sources", len(entries), "playlist", playlist.OutputPath)
 	return nil
 }
 
@@ -190,16 +422,20 @@ func mapAcestreamItems(searchResults []acestream.SearchResult,
 }
 
 // filter returns filtered `searchResults` by criterias in `playlist`.
+//
+// `now` is the time reference for availability update time.
 func filter(log *logger.Logger,
 	searchResults []acestream.SearchResult,
-	playlist config.Playlist) []acestream.SearchResult {
+	playlist config.Playlist,
+	now time.Time) []acestream.SearchResult {
 	searchResults = filterByStatus(log, searchResults, playlist)
 	searchResults = filterByAvailability(log, searchResults, playlist)
-	searchResults = filterByAvailabilityUpdateTime(log, searchResults, playlist)
+	searchResults = filterByAvailabilityUpdateTime(log, searchResults, playlist, now)
 	searchResults = filterByCategories(log, searchResults, playlist)
 	searchResults = filterByLanguages(log, searchResults, playlist)
 	searchResults = filterByCountries(log, searchResults, playlist)
 	searchResults = filterByName(log, searchResults, playlist)
+	searchResults = filterBySourcesPerName(log, searchResults, playlist)
 	return searchResults
 }
 
@@ -238,13 +474,15 @@ func filterByAvailability(log *logger.Logger,
 	return searchResults
 }
 
-// filterByAvailabilityUpdateTime returns filtered `searchResults` by availability update time in `playlist`.
+// filterByAvailabilityUpdateTime returns filtered `searchResults` by availability update time in `playlist`, relative
+// to `now`.
 func filterByAvailabilityUpdateTime(log *logger.Logger,
 	searchResults []acestream.SearchResult,
-	playlist config.Playlist) []acestream.SearchResult {
+	playlist config.Playlist,
+	now time.Time) []acestream.SearchResult {
 	prevSources := acestream.GetSourcesAmount(searchResults)
 	searchResults = filterAcestreamItems(searchResults, func(item acestream.Item, _ int) bool {
-		availabilityUpdatedAgo := time.Now().Unix() - item.AvailabilityUpdatedAt
+		availabilityUpdatedAgo := now.Unix() - item.AvailabilityUpdatedAt
 		keep := availabilityUpdatedAgo <= int64(playlist.AvailabilityUpdatedThreshold.Seconds())
 		if !keep {
 			log.DebugFi("Rejected", "name", item.Name, "availability updated at", item.AvailabilityUpdatedAt,
@@ -382,11 +620,18 @@ func filterByName(log *logger.Logger,
 	searchResults []acestream.SearchResult,
 	playlist config.Playlist) []acestream.SearchResult {
 	prevSources := acestream.GetSourcesAmount(searchResults)
+	matchName := func(item acestream.Item) string {
+		if lo.FromPtr(playlist.MatchNormalizedName) {
+			return text.Normalize(item.Name)
+		}
+		return item.Name
+	}
 	if len(playlist.NameRxFilter) > 0 {
 		searchResults = filterAcestreamItems(searchResults, func(item acestream.Item, _ int) bool {
+			name := matchName(item)
 			return lo.SomeBy(playlist.NameRxFilter, func(rxStr string) bool {
 				rx := regexp2.MustCompile(rxStr, regexp2.RE2)
-				keep, _ := rx.MatchString(item.Name)
+				keep, _ := rx.MatchString(name)
 				if !keep {
 					log.DebugFi("Rejected", "name", item.Name, "playlist", playlist.OutputPath)
 				}
@@ -396,9 +641,10 @@ func filterByName(log *logger.Logger,
 	}
 	if len(playlist.NameRxBlacklist) > 0 {
 		searchResults = rejectAcestreamItems(searchResults, func(item acestream.Item, _ int) bool {
+			name := matchName(item)
 			return lo.SomeBy(playlist.NameRxBlacklist, func(rxStr string) bool {
 				rx := regexp2.MustCompile(rxStr, regexp2.RE2)
-				reject, _ := rx.MatchString(item.Name)
+				reject, _ := rx.MatchString(name)
 				if reject {
 					log.DebugFi("Rejected", "name", item.Name, "playlist", playlist.OutputPath)
 				}
@@ -411,6 +657,33 @@ func filterByName(log *logger.Logger,
 	return searchResults
 }
 
+// filterBySourcesPerName returns filtered `searchResults` by maximum amount of sources per name in `playlist`.
+func filterBySourcesPerName(log *logger.Logger,
+	searchResults []acestream.SearchResult,
+	playlist config.Playlist) []acestream.SearchResult {
+	prevSources := acestream.GetSourcesAmount(searchResults)
+	if maxSources := lo.FromPtr(playlist.MaxSourcesPerName); maxSources > 0 {
+		nameSourcesMap := map[string]int{}
+		for _, sr := range searchResults {
+			for _, item := range sr.Items {
+				nameSourcesMap[item.Name]++
+			}
+		}
+		for name, sources := range nameSourcesMap {
+			if sources > maxSources {
+				log.DebugFi("Rejected", "name", name, "sources", sources, "playlist", playlist.OutputPath)
+			}
+		}
+		searchResults = rejectAcestreamItems(searchResults, func(item acestream.Item, _ int) bool {
+			return nameSourcesMap[item.Name] > maxSources
+		})
+	}
+	currSources := acestream.GetSourcesAmount(searchResults)
+	log.InfoFi("Rejected", "sources", prevSources-currSources, "by", "sources per name",
+		"playlist", playlist.OutputPath)
+	return searchResults
+}
+
 // removeDead returns `searchResults` without unavailable sources using settings in `playlist` and Ace Stream Engine
 // address `engineAddr`.
 //
@@ -3,6 +3,10 @@ package m3u
 import (
 	"bytes"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 	"sync"
@@ -12,9 +16,11 @@ import (
 	"github.com/dlclark/regexp2"
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
+	"github.com/ziutek/dvb/ts"
 
 	"m3u_gen_acestream/acestream"
 	"m3u_gen_acestream/config"
+	"m3u_gen_acestream/stats"
 	"m3u_gen_acestream/util/logger"
 )
 
@@ -217,7 +223,8 @@ func TestFilterByAvailabilityUpdateTime(t *testing.T) {
 	var consoleBuff bytes.Buffer
 	log := logger.New(logger.DebugLevel, &consoleBuff)
 
-	now := time.Now().Unix()
+	nowTime := time.Now()
+	now := nowTime.Unix()
 
 	tests := map[string]TransformTest{
 		"two items exceed threshold": {
@@ -247,7 +254,7 @@ func TestFilterByAvailabilityUpdateTime(t *testing.T) {
 	}
 
 	for name, test := range tests {
-		actual := filterByAvailabilityUpdateTime(log, test.input, test.playlist)
+		actual := filterByAvailabilityUpdateTime(log, test.input, test.playlist, nowTime)
 		assert.Exactly(t, test.expected, actual, fmt.Sprintf("Bad returned value in test '%v'", name))
 		msg := fmt.Sprintf("Bad log output in test '%v'", name)
 		for _, line := range test.logLines {
@@ -1071,6 +1078,54 @@ func TestFilterByName(t *testing.T) {
 				timeRx + ` INFO Rejected: sources "5", by "name", playlist "file.m3u8"`,
 			},
 		},
+		"filter matches normalized name": {
+			input: []acestream.SearchResult{
+				{Items: []acestream.Item{{Name: "ＨＢＯ"}, {Name: "Ｈ Ｂ Ｏ"}}},
+			},
+			playlist: config.Playlist{
+				OutputPath:          "file.m3u8",
+				NameRxFilter:        []string{`^hbo$`},
+				NameRxBlacklist:     []string{},
+				MatchNormalizedName: lo.ToPtr(true),
+			},
+			expected: []acestream.SearchResult{
+				{Items: []acestream.Item{{Name: "ＨＢＯ"}}},
+			},
+			logLines: []string{
+				timeRx + ` DEBUG Rejected: name "Ｈ Ｂ Ｏ", playlist "file.m3u8"`,
+				timeRx + ` INFO Rejected: sources "1", by "name", playlist "file.m3u8"`,
+			},
+		},
+		"filter does not match full-width name without normalization": {
+			input: []acestream.SearchResult{
+				{Items: []acestream.Item{{Name: "ＨＢＯ"}}},
+			},
+			playlist: config.Playlist{
+				OutputPath:          "file.m3u8",
+				NameRxFilter:        []string{`^hbo$`},
+				NameRxBlacklist:     []string{},
+				MatchNormalizedName: lo.ToPtr(false),
+			},
+			expected: []acestream.SearchResult{
+				{Items: []acestream.Item{}},
+			},
+			logLines: []string{timeRx + ` INFO Rejected: sources "1", by "name", playlist "file.m3u8"`},
+		},
+		"blacklist matches normalized name": {
+			input: []acestream.SearchResult{
+				{Items: []acestream.Item{{Name: "Ｅｒｏｔｉｃ 🔥"}, {Name: "Café"}}},
+			},
+			playlist: config.Playlist{
+				OutputPath:          "file.m3u8",
+				NameRxFilter:        []string{},
+				NameRxBlacklist:     []string{`^erotic$`},
+				MatchNormalizedName: lo.ToPtr(true),
+			},
+			expected: []acestream.SearchResult{
+				{Items: []acestream.Item{{Name: "Café"}}},
+			},
+			logLines: []string{timeRx + ` INFO Rejected: sources "1", by "name", playlist "file.m3u8"`},
+		},
 	}
 
 	for name, test := range tests {
@@ -1084,6 +1139,74 @@ func TestFilterByName(t *testing.T) {
 	}
 }
 
+func TestFilterBySourcesPerName(t *testing.T) {
+	var consoleBuff bytes.Buffer
+	log := logger.New(logger.DebugLevel, &consoleBuff)
+
+	spamItems := lo.Times(200, func(idx int) acestream.Item {
+		return acestream.Item{Name: "spam", Infohash: fmt.Sprint(idx)}
+	})
+
+	tests := map[string]TransformTest{
+		"limit is nil": {
+			input: []acestream.SearchResult{
+				{Items: []acestream.Item{{Name: "name 1"}, {Name: "name 1"}}},
+			},
+			playlist: config.Playlist{
+				OutputPath:        "file.m3u8",
+				MaxSourcesPerName: nil,
+			},
+			expected: []acestream.SearchResult{
+				{Items: []acestream.Item{{Name: "name 1"}, {Name: "name 1"}}},
+			},
+			logLines: []string{timeRx + ` INFO Rejected: sources "0", by "sources per name", playlist "file.m3u8"`},
+		},
+		"limit is 0": {
+			input: []acestream.SearchResult{
+				{Items: spamItems},
+			},
+			playlist: config.Playlist{
+				OutputPath:        "file.m3u8",
+				MaxSourcesPerName: lo.ToPtr(0),
+			},
+			expected: []acestream.SearchResult{
+				{Items: spamItems},
+			},
+			logLines: []string{timeRx + ` INFO Rejected: sources "0", by "sources per name", playlist "file.m3u8"`},
+		},
+		"name with 200 sources exceeds limit": {
+			input: []acestream.SearchResult{
+				{Items: spamItems},
+				{Items: []acestream.Item{{Name: "name 1"}, {Name: "name 2"}, {Name: "name 2"}}},
+				{Items: []acestream.Item{{Name: "name 2"}, {Name: "spam"}}},
+			},
+			playlist: config.Playlist{
+				OutputPath:        "file.m3u8",
+				MaxSourcesPerName: lo.ToPtr(100),
+			},
+			expected: []acestream.SearchResult{
+				{Items: []acestream.Item{}},
+				{Items: []acestream.Item{{Name: "name 1"}, {Name: "name 2"}, {Name: "name 2"}}},
+				{Items: []acestream.Item{{Name: "name 2"}}},
+			},
+			logLines: []string{
+				timeRx + ` DEBUG Rejected: name "spam", sources "201", playlist "file.m3u8"`,
+				timeRx + ` INFO Rejected: sources "201", by "sources per name", playlist "file.m3u8"`,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		actual := filterBySourcesPerName(log, test.input, test.playlist)
+		assert.Exactly(t, test.expected, actual, fmt.Sprintf("Bad returned value in test '%v'", name))
+		msg := fmt.Sprintf("Bad log output in test '%v'", name)
+		for _, line := range test.logLines {
+			assert.Regexp(t, regexp2.MustCompile(line, regexp2.RE2), consoleBuff.String(), msg)
+		}
+		consoleBuff.Reset()
+	}
+}
+
 func TestRemoveDead(t *testing.T) {
 	var consoleBuff bytes.Buffer
 	log := logger.New(logger.DebugLevel, &consoleBuff)
@@ -1145,3 +1268,415 @@ func TestRemoveDead(t *testing.T) {
     _, ok = infohashCheckErrorMap.Load(hashDead)
     assert.True(t, ok, "expected infohashCheckErrorMap to contain %s", hashDead)
 }
+
+func TestToEntries(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	input := []acestream.SearchResult{
+		{
+			Icons: []acestream.Icon{{URL: "http://icon"}},
+			Items: []acestream.Item{
+				{
+					Name:                  "name 2",
+					Infohash:              "2",
+					Categories:            []string{"TV", "music", "tv", ""},
+					AvailabilityUpdatedAt: now.Unix() - 3723,
+				},
+				{
+					Name:                  "name 1",
+					Infohash:              "1",
+					Categories:            []string{"music", "tv"},
+					Languages:             []string{"rus", "eng"},
+					Countries:             []string{"ru"},
+					Availability:          0.5,
+					AvailabilityUpdatedAt: now.Unix(),
+				},
+			},
+		},
+	}
+	expected := []Entry{
+		{
+			Name:                          "name 1",
+			Infohash:                      "1",
+			Categories:                    "music;tv",
+			Countries:                     "ru",
+			Languages:                     "eng;rus",
+			EngineAddr:                    "127.0.0.1:6878",
+			TVGName:                       "name_1",
+			IconURL:                       "http://icon",
+			Availability:                  0.5,
+			AvailabilityUpdatedAt:         now.Unix(),
+			AvailabilityUpdatedAgoSeconds: 0,
+			AvailabilityUpdatedAgo:        "0s",
+		},
+		{
+			Name:                          "name 2",
+			Infohash:                      "2",
+			Categories:                    "music;tv",
+			EngineAddr:                    "127.0.0.1:6878",
+			TVGName:                       "name_2",
+			IconURL:                       "http://icon",
+			AvailabilityUpdatedAt:         now.Unix() - 3723,
+			AvailabilityUpdatedAgoSeconds: 3723,
+			AvailabilityUpdatedAgo:        "1h2m3s",
+		},
+	}
+
+	actual := toEntries(input, "127.0.0.1:6878", now)
+	assert.Exactly(t, expected, actual, "Bad returned value")
+}
+
+func TestExcludeInfohashes(t *testing.T) {
+	var consoleBuff bytes.Buffer
+	log := logger.New(logger.DebugLevel, &consoleBuff)
+
+	// Playlist B goes before playlist A it excludes infohashes from, A excludes infohashes from C.
+	playlists := []config.Playlist{
+		{OutputPath: "b.m3u8", ExcludeInfohashesFrom: []string{"a.m3u8"}},
+		{OutputPath: "a.m3u8", ExcludeInfohashesFrom: []string{"c.m3u8"}},
+		{OutputPath: "c.m3u8"},
+	}
+	entriesPerPlaylist := [][]Entry{
+		{{Name: "name 1", Infohash: "1"}, {Name: "name 2", Infohash: "2"}, {Name: "name 3", Infohash: "3"}},
+		{{Name: "name 1", Infohash: "1"}, {Name: "name 3", Infohash: "3"}},
+		{{Name: "name 3", Infohash: "3"}},
+	}
+	expected := [][]Entry{
+		{{Name: "name 2", Infohash: "2"}, {Name: "name 3", Infohash: "3"}},
+		{{Name: "name 1", Infohash: "1"}},
+		{{Name: "name 3", Infohash: "3"}},
+	}
+	logLines := []string{
+		timeRx + ` DEBUG Rejected: name "name 1", infohash "1", written to "a.m3u8", playlist "b.m3u8"`,
+		timeRx + ` INFO Rejected: sources "1", by "infohashes written to a.m3u8", playlist "b.m3u8"`,
+		timeRx + ` INFO Rejected: sources "1", by "infohashes written to c.m3u8", playlist "a.m3u8"`,
+	}
+
+	var entriesOrder, doneOrder []int
+	actual := make([][]Entry, len(playlists))
+	err := excludeInfohashes(log, playlists, func(idx int) []Entry {
+		entriesOrder = append(entriesOrder, idx)
+		return entriesPerPlaylist[idx]
+	}, func(idx int, entries []Entry) error {
+		doneOrder = append(doneOrder, idx)
+		actual[idx] = entries
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Exactly(t, expected, actual, "Bad resolved entries")
+	assert.Exactly(t, []int{2, 1, 0}, entriesOrder, "Playlists to exclude infohashes from should be resolved first")
+	assert.Exactly(t, []int{2, 1, 0}, doneOrder, "Playlist should be done as soon as it is resolved")
+	for _, line := range logLines {
+		assert.Regexp(t, regexp2.MustCompile(line, regexp2.RE2), consoleBuff.String(), "Bad log output")
+	}
+}
+
+func TestPreview(t *testing.T) {
+	var consoleBuff bytes.Buffer
+	log := logger.New(logger.DebugLevel, &consoleBuff)
+
+	now := time.Now().Unix()
+
+	input := []acestream.SearchResult{
+		{Items: []acestream.Item{
+			{Name: "news", Infohash: "1", Status: 2, Categories: []string{"informational"}, AvailabilityUpdatedAt: now},
+			{Name: "news", Infohash: "2", Status: 2, Categories: []string{"informational"}, AvailabilityUpdatedAt: now},
+			{Name: "music", Infohash: "3", Status: 2, Categories: []string{"music"}, AvailabilityUpdatedAt: now},
+		}},
+		{Items: []acestream.Item{
+			{Name: "dead", Infohash: "4", Status: 1, Categories: []string{"music"}, AvailabilityUpdatedAt: now},
+			{Name: "sport", Infohash: "5", Status: 2, Categories: []string{"sport"}, AvailabilityUpdatedAt: now},
+		}},
+	}
+	cfg := &config.Config{
+		EngineAddr: "127.0.0.1:6878",
+		Playlists: []config.Playlist{
+			{
+				OutputPath:                   "all.m3u8",
+				StatusFilter:                 []int{2},
+				AvailabilityUpdatedThreshold: time.Hour,
+				RemoveDeadSources:            lo.ToPtr(true),
+			},
+			{
+				OutputPath:                   "no sport.m3u8",
+				CategoriesBlacklist:          []string{"sport"},
+				StatusFilter:                 []int{1, 2},
+				AvailabilityUpdatedThreshold: time.Hour,
+				RemoveDeadSources:            lo.ToPtr(true),
+			},
+			{
+				OutputPath:                   "empty.m3u8",
+				NameRxFilter:                 []string{`^nothing$`},
+				StatusFilter:                 []int{2},
+				AvailabilityUpdatedThreshold: time.Hour,
+			},
+		},
+	}
+	expected := "playlist\tname\tsources\n" +
+		"all.m3u8\tnews\t2\n" +
+		"all.m3u8\tmusic\t1\n" +
+		"all.m3u8\tsport\t1\n" +
+		"all.m3u8\t\t4\n" +
+		"no sport.m3u8\tnews\t2\n" +
+		"no sport.m3u8\tdead\t1\n" +
+		"no sport.m3u8\tmusic\t1\n" +
+		"no sport.m3u8\t\t4\n" +
+		"empty.m3u8\t\t0\n"
+
+	var out bytes.Buffer
+	err := Preview(log, input, cfg, &out)
+	assert.NoError(t, err)
+	assert.Exactly(t, expected, out.String(), "Bad preview output")
+	assert.NotContains(t, consoleBuff.String(), "Removing dead sources", "Should not remove dead sources")
+}
+
+func TestGenerateRelativeLinks(t *testing.T) {
+	var consoleBuff bytes.Buffer
+	log := logger.New(logger.DebugLevel, &consoleBuff)
+
+	var checkedPaths sync.Map
+	engine := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checkedPaths.Store(r.URL.RequestURI(), true)
+		// More than checker reads at once, so it does not get EOF along with content.
+		w.Write(bytes.Repeat([]byte{0x47}, ts.PktLen*20))
+	}))
+	defer engine.Close()
+
+	now := time.Now().Unix()
+	outputPath := filepath.Join(t.TempDir(), "playlist.m3u8")
+	input := []acestream.SearchResult{
+		{Items: []acestream.Item{{Name: "name 1", Infohash: "1", Status: 2, AvailabilityUpdatedAt: now}}},
+	}
+	cfg := &config.Config{
+		EngineAddr: strings.TrimPrefix(engine.URL, "http://"),
+		Playlists: []config.Playlist{
+			{
+				OutputPath:                   outputPath,
+				HeaderTemplate:               "#EXTM3U\n",
+				EntryTemplate:                "#EXTINF:-1,{{.Name}}\nhttp://{{.EngineAddr}}/ace/getstream?infohash={{.Infohash}}\n",
+				RelativeLinks:                lo.ToPtr(true),
+				StatusFilter:                 []int{2},
+				AvailabilityUpdatedThreshold: time.Hour,
+				RemoveDeadSources:            lo.ToPtr(true),
+				UseMpegTsAnalyzer:            lo.ToPtr(false),
+				CheckRespTimeout:             lo.ToPtr(time.Second * 5),
+				RemoveDeadLinkTemplate:       lo.ToPtr("http://{{.EngineAddr}}/ace/getstream?infohash={{.Infohash}}"),
+				RemoveDeadWorkers:            lo.ToPtr(1),
+			},
+		},
+	}
+
+	err := Generate(log, input, cfg, stats.New())
+	assert.NoError(t, err)
+
+	_, checked := checkedPaths.Load("/ace/getstream?infohash=1")
+	assert.True(t, checked, "Dead source check should use absolute engine address")
+	assert.Contains(t, consoleBuff.String(), `link "`+engine.URL+`/ace/getstream?infohash=1"`)
+
+	actual, err := os.ReadFile(outputPath)
+	assert.NoError(t, err)
+	assert.Exactly(t, "#EXTM3U\n#EXTINF:-1,name 1\n/ace/getstream?infohash=1\n", string(actual), "Bad playlist")
+}
+
+func TestWrite(t *testing.T) {
+	var consoleBuff bytes.Buffer
+	log := logger.New(logger.DebugLevel, &consoleBuff)
+
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	entries := []Entry{
+		{Name: "name 1", Infohash: "1"},
+		{Name: "name 2", Infohash: "2"},
+		{Name: "name 2", Infohash: "3"},
+	}
+
+	tests := map[string]struct {
+		playlist config.Playlist
+		expected string
+	}{
+		"no title and count comment": {
+			playlist: config.Playlist{
+				HeaderTemplate: "#EXTM3U\n",
+				EntryTemplate:  "{{.Name}}\n",
+			},
+			expected: "#EXTM3U\nname 1\nname 2\nname 2\n",
+		},
+		"title and count comment": {
+			playlist: config.Playlist{
+				HeaderTemplate:   "#EXTM3U url-tvg=\"http://epg\"\n",
+				PlaylistTitle:    lo.ToPtr("My channels"),
+				EmitCountComment: lo.ToPtr(true),
+				EntryTemplate:    "{{.Name}}\n",
+			},
+			expected: "#EXTM3U url-tvg=\"http://epg\"\n" +
+				"#PLAYLIST:My channels\n" +
+				"# channels: 2, generated: 2025-01-02T03:04:05Z\n" +
+				"name 1\nname 2\nname 2\n",
+		},
+		"header without trailing new line": {
+			playlist: config.Playlist{
+				HeaderTemplate:   "#EXTM3U",
+				PlaylistTitle:    lo.ToPtr(""),
+				EmitCountComment: lo.ToPtr(true),
+				EntryTemplate:    "{{.Name}}\n",
+			},
+			expected: "#EXTM3U\n# channels: 2, generated: 2025-01-02T03:04:05Z\nname 1\nname 2\nname 2\n",
+		},
+	}
+
+	for name, test := range tests {
+		test.playlist.OutputPath = filepath.Join(t.TempDir(), "playlist.m3u8")
+		err := write(log, entries, test.playlist, now)
+		assert.NoError(t, err, fmt.Sprintf("Unexpected error in test '%v'", name))
+		actual, err := os.ReadFile(test.playlist.OutputPath)
+		assert.NoError(t, err, fmt.Sprintf("Unexpected error in test '%v'", name))
+		assert.Exactly(t, test.expected, string(actual), fmt.Sprintf("Bad playlist in test '%v'", name))
+	}
+}
+
+func TestMergeByNormalizedName(t *testing.T) {
+	var consoleBuff bytes.Buffer
+	log := logger.New(logger.DebugLevel, &consoleBuff)
+
+	playlist := config.Playlist{OutputPath: "file.m3u8", MergeByNormalizedName: lo.ToPtr(true)}
+	entries := []Entry{
+		{Name: "CNN", TVGName: "CNN", Infohash: "4", Availability: 1},
+		{Name: "HBO HD", TVGName: "HBO_HD", Categories: "movies", Infohash: "1", Availability: 0.5},
+		{Name: "hbo  hd", TVGName: "hbo__hd", Categories: "tv", Infohash: "2", Availability: 0.9},
+		{Name: "ＨＢＯ ＨＤ", TVGName: "ＨＢＯ_ＨＤ", Infohash: "3", Availability: 0.7},
+		{Name: "HBO HD", TVGName: "HBO_HD", Infohash: "2", Availability: 0.8},
+		{Name: "HBO 2", TVGName: "HBO_2", Infohash: "5", Availability: 1},
+	}
+	expected := []Entry{
+		{Name: "CNN", TVGName: "CNN", Infohash: "4", Availability: 1},
+		{Name: "hbo  hd", TVGName: "hbo__hd", Categories: "tv", Infohash: "2", Availability: 0.9},
+		{Name: "hbo  hd", TVGName: "hbo__hd", Categories: "tv", Infohash: "3", Availability: 0.7},
+		{Name: "hbo  hd", TVGName: "hbo__hd", Categories: "tv", Infohash: "1", Availability: 0.5},
+		{Name: "HBO 2", TVGName: "HBO_2", Infohash: "5", Availability: 1},
+	}
+	logLines := []string{
+		timeRx + ` DEBUG Merged: names "\["hbo  hd","HBO HD","ＨＢＯ ＨＤ"\]", into "hbo  hd", sources "3", ` +
+			`playlist "file.m3u8"`,
+		timeRx + ` INFO Merged: channels "2", by "normalized name", playlist "file.m3u8"`,
+	}
+
+	actual := mergeByNormalizedName(log, entries, playlist)
+	assert.Exactly(t, expected, actual, "Bad returned value")
+	for _, line := range logLines {
+		assert.Regexp(t, regexp2.MustCompile(line, regexp2.RE2), consoleBuff.String(), "Bad log output")
+	}
+}
+
+func TestGenerateMergeByNormalizedName(t *testing.T) {
+	var consoleBuff bytes.Buffer
+	log := logger.New(logger.DebugLevel, &consoleBuff)
+
+	now := time.Now().Unix()
+	outputPath := filepath.Join(t.TempDir(), "playlist.m3u8")
+	input := []acestream.SearchResult{
+		{Items: []acestream.Item{
+			{Name: "HBO HD", Infohash: "1", Status: 2, Availability: 0.5, AvailabilityUpdatedAt: now},
+			{Name: "hbo  hd", Infohash: "2", Status: 2, Availability: 0.9, AvailabilityUpdatedAt: now},
+		}},
+		{Items: []acestream.Item{
+			{Name: "ＨＢＯ ＨＤ", Infohash: "3", Status: 2, Availability: 0.7, AvailabilityUpdatedAt: now},
+			{Name: "CNN", Infohash: "4", Status: 2, Availability: 1, AvailabilityUpdatedAt: now},
+		}},
+	}
+	cfg := &config.Config{
+		EngineAddr: "127.0.0.1:6878",
+		Playlists: []config.Playlist{
+			{
+				OutputPath:                   outputPath,
+				HeaderTemplate:               "#EXTM3U\n",
+				EntryTemplate:                "#EXTINF:-1,{{.Name}}\nhttp://{{.EngineAddr}}/ace/getstream?infohash={{.Infohash}}\n",
+				StatusFilter:                 []int{2},
+				AvailabilityUpdatedThreshold: time.Hour,
+				MergeByNormalizedName:        lo.ToPtr(true),
+				RemoveDeadSources:            lo.ToPtr(false),
+			},
+		},
+	}
+
+	err := Generate(log, input, cfg, stats.New())
+	assert.NoError(t, err)
+
+	actual, err := os.ReadFile(outputPath)
+	assert.NoError(t, err)
+	expected := "#EXTM3U\n" +
+		"#EXTINF:-1,CNN\nhttp://127.0.0.1:6878/ace/getstream?infohash=4\n" +
+		"#EXTINF:-1,hbo  hd\nhttp://127.0.0.1:6878/ace/getstream?infohash=2\n" +
+		"#EXTINF:-1,hbo  hd\nhttp://127.0.0.1:6878/ace/getstream?infohash=3\n" +
+		"#EXTINF:-1,hbo  hd\nhttp://127.0.0.1:6878/ace/getstream?infohash=1\n"
+	assert.Exactly(t, expected, string(actual), "Every alternate source should be written under merged name")
+}
+
+func TestGenerateWrittenStats(t *testing.T) {
+	var consoleBuff bytes.Buffer
+	log := logger.New(logger.DebugLevel, &consoleBuff)
+
+	now := time.Now().Unix()
+	outputDir := t.TempDir()
+	input := []acestream.SearchResult{
+		{Items: []acestream.Item{
+			{Name: "name 1", Infohash: "1", Status: 2, AvailabilityUpdatedAt: now},
+			{Name: "name 2", Infohash: "2", Status: 1, AvailabilityUpdatedAt: now},
+		}},
+	}
+	newPlaylist := func(outputPath string, statusFilter []int) config.Playlist {
+		return config.Playlist{
+			OutputPath:                   filepath.Join(outputDir, outputPath),
+			EntryTemplate:                "{{.Infohash}}\n",
+			StatusFilter:                 statusFilter,
+			AvailabilityUpdatedThreshold: time.Hour,
+			RemoveDeadSources:            lo.ToPtr(false),
+		}
+	}
+	cfg := &config.Config{
+		EngineAddr: "127.0.0.1:6878",
+		Playlists:  []config.Playlist{newPlaylist("a.m3u8", []int{2}), newPlaylist("b.m3u8", []int{1, 2})},
+	}
+
+	st := stats.New()
+	err := Generate(log, input, cfg, st)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		filepath.Join(outputDir, "a.m3u8"): 1,
+		filepath.Join(outputDir, "b.m3u8"): 2,
+	}, st.Summary().WrittenSources)
+}
+
+func TestGenerateWritesPlaylistsInTurn(t *testing.T) {
+	var consoleBuff bytes.Buffer
+	log := logger.New(logger.DebugLevel, &consoleBuff)
+
+	now := time.Now().Unix()
+	outputDir := t.TempDir()
+	input := []acestream.SearchResult{
+		{Items: []acestream.Item{{Name: "name 1", Infohash: "1", Status: 2, AvailabilityUpdatedAt: now}}},
+	}
+	newPlaylist := func(outputPath string) config.Playlist {
+		return config.Playlist{
+			OutputPath:                   filepath.Join(outputDir, outputPath),
+			EntryTemplate:                "{{.Infohash}}\n",
+			StatusFilter:                 []int{2},
+			AvailabilityUpdatedThreshold: time.Hour,
+			RemoveDeadSources:            lo.ToPtr(false),
+		}
+	}
+	// Second playlist can not be written as it's parent directory is a file of the first playlist.
+	cfg := &config.Config{
+		EngineAddr: "127.0.0.1:6878",
+		Playlists: []config.Playlist{
+			newPlaylist("a.m3u8"),
+			newPlaylist(filepath.Join("a.m3u8", "b.m3u8")),
+			newPlaylist("c.m3u8"),
+		},
+	}
+
+	err := Generate(log, input, cfg, stats.New())
+	assert.Error(t, err)
+	actual, err := os.ReadFile(filepath.Join(outputDir, "a.m3u8"))
+	assert.NoError(t, err, "Playlist should be written before the next one is generated")
+	assert.Exactly(t, "1\n", string(actual))
+	assert.NoFileExists(t, filepath.Join(outputDir, "c.m3u8"), "Generation should stop at the first error")
+}
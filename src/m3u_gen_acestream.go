@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/adampresley/sigint"
@@ -14,6 +15,7 @@ import (
 	"m3u_gen_acestream/cli"
 	"m3u_gen_acestream/config"
 	"m3u_gen_acestream/m3u"
+	"m3u_gen_acestream/stats"
 	"m3u_gen_acestream/updater"
 	"m3u_gen_acestream/util/logger"
 	"m3u_gen_acestream/util/network"
@@ -39,16 +41,48 @@ func main() {
 
 	log.SetLevel(flags.LogLevel)
 	logFile, err := log.AddFileWriter(flags.LogFile)
-	if err == nil {
-		// Closing nil file does not panic.
-		defer logFile.Close()
-	} else {
+	if err != nil {
 		log.Error(err)
 	}
 
+	st := stats.New()
+	var exitOnce sync.Once
+
+	// finish sets exit `code` in run summary and prints it to stderr, so it does not mix with output to stdout.
+	finish := func(code int) {
+		st.SetExitCode(code)
+		if flags.SummaryJSON {
+			if err := st.WriteJSON(os.Stderr); err != nil {
+				log.Error(errors.Wrap(err, "Print summary"))
+			}
+		}
+	}
+
+	// exit finishes the run, closes log file and terminates the program with `code`.
+	exit := func(code int) {
+		exitOnce.Do(func() {
+			finish(code)
+			// Closing nil file does not panic.
+			logFile.Close()
+			os.Exit(code)
+		})
+	}
+
+	// fatal adds `err` to run summary, finishes the run and terminates the program with fatal level `err` message.
+	fatal := func(err error) {
+		exitOnce.Do(func() {
+			st.AddError(err)
+			// Fatal level message terminates the program with code 255, unless it is filtered out by log level.
+			finish(255)
+			log.Fatal(err)
+			os.Exit(255)
+		})
+	}
+
 	sigint.Listen(func() {
 		log.Warn("SIGINT or SIGTERM signal received, shutting down")
-		os.Exit(0)
+		st.AddError(errors.New("Interrupted by SIGINT or SIGTERM signal"))
+		exit(0)
 	})
 
 	if flags.Update {
@@ -56,7 +90,7 @@ func main() {
 		updater := updater.New(log, updaterHttpClient)
 
 		if err := updater.Update(programVersion); err != nil {
-			log.Fatal(errors.Wrap(err, "Self update failed"))
+			fatal(errors.Wrap(err, "Self update failed"))
 		}
 	}
 
@@ -64,23 +98,55 @@ func main() {
 
 	cfg, isNewCfg, err := config.Init(log, flags.CfgPath)
 	if err != nil {
-		log.Fatal(errors.Wrap(err, "Initialize config"))
+		fatal(errors.Wrap(err, "Initialize config"))
 	}
 	if isNewCfg {
 		log.InfoFi("Created default config, please verify it and start this program again", "path", flags.CfgPath)
-		os.Exit(0)
+		exit(0)
 	}
 
 	engineHttpClient := network.NewHTTPClient(time.Second * 5)
 	engine := acestream.NewEngine(log, engineHttpClient, cfg.EngineAddr)
+	stopPhase := st.StartPhase("connect")
 	engine.WaitForConnection(context.Background())
+	stopPhase()
 
+	if flags.BenchSearch > 0 {
+		bench, err := engine.BenchSearch(context.Background(), flags.BenchSearch)
+		if err != nil {
+			fatal(errors.Wrap(err, "Benchmark search"))
+		}
+		log.Info("Benchmark finished")
+		fmt.Println("pages\tsources\tduration\tpages/sec\tsources/sec\tavg engine time")
+		fmt.Printf("%v\t%v\t%v\t%.2f\t%.2f\t%v\n", bench.Pages, bench.Sources, bench.Duration, bench.PagesPerSec,
+			bench.SourcesPerSec, bench.AvgEngineTime)
+		exit(0)
+	}
+
+	stopPhase = st.StartPhase("search")
 	results, err := engine.SearchAll(context.Background())
+	stopPhase()
 	if err != nil {
-		log.Error(errors.Wrap(err, "Search for available ace stream channels"))
+		err = errors.Wrap(err, "Search for available ace stream channels")
+		log.Error(err)
+		st.AddError(err)
 	}
+	st.SetReceived(len(results), acestream.GetSourcesAmount(results))
 
-	if err := m3u.Generate(log, results, cfg); err != nil {
-		log.Error(errors.Wrap(err, "Generate M3U file"))
+	if flags.Preview {
+		if err := m3u.Preview(log, results, cfg, os.Stdout); err != nil {
+			fatal(errors.Wrap(err, "Preview M3U files"))
+		}
+		exit(0)
 	}
+
+	stopPhase = st.StartPhase("generate")
+	if err := m3u.Generate(log, results, cfg, st); err != nil {
+		err = errors.Wrap(err, "Generate M3U file")
+		log.Error(err)
+		st.AddError(err)
+	}
+	stopPhase()
+
+	exit(0)
 }
@@ -0,0 +1,123 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/goccy/go-json"
+)
+
+// Stats represents accumulator of program run statistics. It is safe for concurrent use.
+type Stats struct {
+	mu               sync.Mutex
+	start            time.Time
+	phases           map[string]time.Duration
+	channelsReceived int
+	sourcesReceived  int
+	written          map[string]int
+	exitCode         int
+	errors           []string
+}
+
+// Summary represents program run statistics to encode as JSON.
+type Summary struct {
+	DurationSeconds  float64            `json:"duration_seconds"`
+	PhaseSeconds     map[string]float64 `json:"phase_seconds"`
+	ChannelsReceived int                `json:"channels_received"`
+	SourcesReceived  int                `json:"sources_received"`
+	WrittenSources   map[string]int     `json:"written_sources"`
+	ExitCode         int                `json:"exit_code"`
+	Status           string             `json:"status"`
+	Errors           []string           `json:"errors"`
+}
+
+// New returns new statistics accumulator with run start time set to current time.
+func New() *Stats {
+	return &Stats{
+		start:   time.Now(),
+		phases:  map[string]time.Duration{},
+		written: map[string]int{},
+		errors:  []string{},
+	}
+}
+
+// StartPhase starts measuring duration of phase `name` and returns function to stop it.
+func (s *Stats) StartPhase(name string) func() {
+	start := time.Now()
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.phases[name] += time.Since(start)
+	}
+}
+
+// SetReceived sets amount of `channels` and `sources` received from engine.
+func (s *Stats) SetReceived(channels, sources int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channelsReceived = channels
+	s.sourcesReceived = sources
+}
+
+// SetWritten sets amount of `sources` written to playlist at `outputPath`.
+func (s *Stats) SetWritten(outputPath string, sources int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.written[outputPath] = sources
+}
+
+// SetExitCode sets exit `code` of the program.
+func (s *Stats) SetExitCode(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exitCode = code
+}
+
+// AddError adds `err` to the run errors. Nil `err` is ignored.
+func (s *Stats) AddError(err error) {
+	if err != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.errors = append(s.errors, err.Error())
+	}
+}
+
+// Summary returns statistics accumulated from the run start up to now. Status is "success" if exit code is 0,
+// regardless of errors added.
+func (s *Stats) Summary() Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	phaseSeconds := map[string]float64{}
+	for name, duration := range s.phases {
+		phaseSeconds[name] = duration.Seconds()
+	}
+	status := "success"
+	if s.exitCode != 0 {
+		status = "failure"
+	}
+	return Summary{
+		DurationSeconds:  time.Since(s.start).Seconds(),
+		PhaseSeconds:     phaseSeconds,
+		ChannelsReceived: s.channelsReceived,
+		SourcesReceived:  s.sourcesReceived,
+		WrittenSources:   maps.Clone(s.written),
+		ExitCode:         s.exitCode,
+		Status:           status,
+		Errors:           slices.Clone(s.errors),
+	}
+}
+
+// WriteJSON writes summary as a single line JSON object to `w`.
+func (s *Stats) WriteJSON(w io.Writer) error {
+	bytes, err := json.Marshal(s.Summary())
+	if err != nil {
+		return errors.Wrap(err, "Encode summary")
+	}
+	_, err = fmt.Fprintln(w, string(bytes))
+	return errors.Wrap(err, "Write summary")
+}
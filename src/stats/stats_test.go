@@ -0,0 +1,75 @@
+package stats
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummary(t *testing.T) {
+	st := New()
+	summary := st.Summary()
+	assert.Equal(t, "success", summary.Status)
+	assert.Empty(t, summary.Errors)
+	assert.Empty(t, summary.PhaseSeconds)
+	assert.Empty(t, summary.WrittenSources)
+
+	stopPhase := st.StartPhase("search")
+	time.Sleep(time.Millisecond * 10)
+	stopPhase()
+	st.SetReceived(3, 7)
+	st.SetWritten("a.m3u8", 5)
+	st.SetWritten("b.m3u8", 2)
+	st.AddError(nil)
+
+	summary = st.Summary()
+	assert.GreaterOrEqual(t, summary.PhaseSeconds["search"], 0.01)
+	assert.GreaterOrEqual(t, summary.DurationSeconds, summary.PhaseSeconds["search"])
+	assert.Equal(t, 3, summary.ChannelsReceived)
+	assert.Equal(t, 7, summary.SourcesReceived)
+	assert.Equal(t, map[string]int{"a.m3u8": 5, "b.m3u8": 2}, summary.WrittenSources)
+	assert.Empty(t, summary.Errors, "Nil error should be ignored")
+
+	st.AddError(errors.New("Search failed"))
+	summary = st.Summary()
+	assert.Equal(t, "success", summary.Status, "Errors should not change status of program exited with 0")
+	assert.Equal(t, []string{"Search failed"}, summary.Errors)
+
+	st.SetExitCode(1)
+	summary = st.Summary()
+	assert.Equal(t, 1, summary.ExitCode)
+	assert.Equal(t, "failure", summary.Status)
+}
+
+func TestWriteJSON(t *testing.T) {
+	st := New()
+	stopPhase := st.StartPhase("generate")
+	stopPhase()
+	st.SetReceived(1, 2)
+	st.SetWritten("a.m3u8", 2)
+	st.AddError(errors.New("Generate failed"))
+	st.SetExitCode(1)
+
+	var out bytes.Buffer
+	assert.NoError(t, st.WriteJSON(&out))
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"), "Summary should be a single line")
+
+	var actual map[string]any
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &actual))
+	for _, key := range []string{"duration_seconds", "phase_seconds", "channels_received", "sources_received",
+		"written_sources", "exit_code", "status", "errors"} {
+		assert.Contains(t, actual, key, "Summary should contain key %v", key)
+	}
+	assert.Contains(t, actual["phase_seconds"], "generate")
+	assert.EqualValues(t, 1, actual["channels_received"])
+	assert.EqualValues(t, 2, actual["sources_received"])
+	assert.Equal(t, map[string]any{"a.m3u8": float64(2)}, actual["written_sources"])
+	assert.EqualValues(t, 1, actual["exit_code"])
+	assert.Equal(t, "failure", actual["status"])
+	assert.Equal(t, []any{"Generate failed"}, actual["errors"])
+}
@@ -0,0 +1,30 @@
+package text
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// decorative represents unicode ranges which are removed from a string during normalization: diacritic marks,
+// format characters (such as zero width joiners) and other symbols (such as emojis).
+var decorative = []*unicode.RangeTable{unicode.Mn, unicode.Me, unicode.Cf, unicode.So}
+
+// Normalize returns `s` folded to it's compatibility form with decorative characters removed, converted to lower case
+// and with sequences of white space collapsed into a single space.
+//
+// For example, full-width "ＨＢＯ  Ｈ́Ｄ 🔥" becomes "hbo hd".
+func Normalize(s string) string {
+	isDecorative := runes.Predicate(func(r rune) bool {
+		return unicode.In(r, decorative...)
+	})
+	normalizer := transform.Chain(norm.NFKD, runes.Remove(isDecorative), norm.NFC)
+	out, _, err := transform.String(normalizer, s)
+	if err != nil {
+		out = s
+	}
+	return strings.Join(strings.Fields(strings.ToLower(out)), " ")
+}
@@ -0,0 +1,36 @@
+package text
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "", expected: ""},
+		{input: "hbo hd", expected: "hbo hd"},
+		{input: "HBO HD", expected: "hbo hd"},
+		// Full-width characters.
+		{input: "ＨＢＯ ＨＤ", expected: "hbo hd"},
+		// Compatibility ligatures.
+		{input: "ﬁlm box", expected: "film box"},
+		// Diacritics.
+		{input: "Café Ñews", expected: "cafe news"},
+		{input: "Ｈ́Ｄ", expected: "hd"},
+		// Emojis with variation selectors and zero width joiners.
+		{input: "🔥 Sport 🔥", expected: "sport"},
+		{input: "❤️ Love", expected: "love"},
+		{input: "👨‍👩‍👧 Family", expected: "family"},
+		// White space collapsing.
+		{input: "  BBC\t One \n HD ", expected: "bbc one hd"},
+		{input: "ＨＢＯ  Ｈ́Ｄ 🔥", expected: "hbo hd"},
+	}
+
+	for _, test := range tests {
+		assert.Exactly(t, test.expected, Normalize(test.input), "Bad normalization of %q", test.input)
+	}
+}